@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims is the payload of a canvas auth token: who the user is and what
+// they're allowed to do, enforced per-message in readPump.
+type Claims struct {
+	UserID      string   `json:"sub"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+// Has reports whether the token grants perm (e.g. "edit", "rename", "op").
+func (c *Claims) Has(perm string) bool {
+	for _, p := range c.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies a bearer token and returns the claims it carries.
+// Pulled out as an interface so tests can inject a fake verifier instead of
+// signing real JWTs.
+type Authenticator interface {
+	Authenticate(token string) (*Claims, error)
+}
+
+// JWTAuthenticator verifies HS256-signed tokens against a shared secret.
+type JWTAuthenticator struct {
+	secret []byte
+}
+
+// NewJWTAuthenticator returns an Authenticator backed by an HS256 secret.
+func NewJWTAuthenticator(secret string) *JWTAuthenticator {
+	return &JWTAuthenticator{secret: []byte(secret)}
+}
+
+func (a *JWTAuthenticator) Authenticate(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return a.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("token missing sub claim")
+	}
+	return claims, nil
+}
+
+// authenticator verifies every WebSocket upgrade; set in main before the
+// server starts accepting connections.
+var authenticator Authenticator
+
+// tokenFromRequest pulls a bearer token from either the ?token= query
+// string or an "Authorization: Bearer <token>" header.
+func tokenFromRequest(r *http.Request) string {
+	if tok := r.URL.Query().Get("token"); tok != "" {
+		return tok
+	}
+	auth := r.Header.Get("Authorization")
+	if rest, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return rest
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// maxBlobSize bounds how large a single uploaded attachment may be.
+const maxBlobSize = 20 << 20 // 20MB
+
+// blobIDPattern matches a sha256 hex digest, the only shape Put ever
+// produces. Rejecting anything else before it reaches blobPath/metaPath
+// keeps a client-supplied blobId from escaping Dir via "../".
+var blobIDPattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// validBlobID reports whether id is a well-formed blobId.
+func validBlobID(id string) bool {
+	return blobIDPattern.MatchString(id)
+}
+
+// blobMeta is the sidecar persisted next to each blob so /blob/{sha} can
+// serve it with the right Content-Type after a restart.
+type blobMeta struct {
+	Mime string `json:"mime"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// BlobStore is a content-addressed store for attachment bytes: the blob at
+// Dir/<sha256> is keyed by its own hash, so identical uploads dedupe for
+// free.
+type BlobStore struct {
+	Dir string
+}
+
+// NewBlobStore returns a BlobStore rooted at dir, creating it if needed.
+func NewBlobStore(dir string) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &BlobStore{Dir: dir}, nil
+}
+
+func (b *BlobStore) blobPath(sha string) string { return filepath.Join(b.Dir, sha) }
+func (b *BlobStore) metaPath(sha string) string { return filepath.Join(b.Dir, sha+".json") }
+
+// Put stores data under its sha256 hash (a no-op if already present) along
+// with its mime type and original filename, and returns the blobId.
+func (b *BlobStore) Put(data []byte, mime, name string) (string, error) {
+	sum := sha256.Sum256(data)
+	sha := hex.EncodeToString(sum[:])
+
+	if _, err := os.Stat(b.blobPath(sha)); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(b.blobPath(sha), data, 0o644); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	meta := blobMeta{Mime: mime, Name: name, Size: int64(len(data))}
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(b.metaPath(sha), buf, 0o644); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// Stat returns a blob's metadata without reading its bytes, used to
+// validate a blobId an "attach" message references.
+func (b *BlobStore) Stat(sha string) (blobMeta, error) {
+	if !validBlobID(sha) {
+		return blobMeta{}, errors.New("invalid blobId")
+	}
+	raw, err := os.ReadFile(b.metaPath(sha))
+	if err != nil {
+		return blobMeta{}, err
+	}
+	var meta blobMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return blobMeta{}, err
+	}
+	return meta, nil
+}
+
+// Get returns a blob's bytes and metadata for serving over /blob/{sha}.
+func (b *BlobStore) Get(sha string) ([]byte, blobMeta, error) {
+	meta, err := b.Stat(sha)
+	if err != nil {
+		return nil, blobMeta{}, err
+	}
+	data, err := os.ReadFile(b.blobPath(sha))
+	if err != nil {
+		return nil, blobMeta{}, err
+	}
+	return data, meta, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// WCharID identifies a single character in the WOOT sequence: the site
+// (user) that created it plus that site's Lamport clock at creation time.
+// Two WCharIDs are never equal unless they come from the same insert.
+type WCharID struct {
+	SiteID string `json:"siteId"`
+	Clock  int64  `json:"clock"`
+}
+
+// begin and end are fixed sentinel IDs bracketing every document so that
+// inserts at the very start or end always have a valid PrevID/NextID.
+var (
+	beginID = WCharID{SiteID: "", Clock: 0}
+	endID   = WCharID{SiteID: "￿", Clock: 1<<63 - 1}
+)
+
+func (a WCharID) equal(b WCharID) bool {
+	return a.SiteID == b.SiteID && a.Clock == b.Clock
+}
+
+// compareWCharID orders IDs lexicographically by SiteID and breaks ties by
+// Clock, giving every site a total, deterministic order to resolve
+// concurrent inserts at the same position.
+func compareWCharID(a, b WCharID) int {
+	if a.SiteID != b.SiteID {
+		if a.SiteID < b.SiteID {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case a.Clock < b.Clock:
+		return -1
+	case a.Clock > b.Clock:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// WChar is a single character in the WOOT sequence CRDT. Deleted characters
+// are kept as tombstones (Visible=false) so PrevID/NextID references from
+// other sites remain resolvable.
+type WChar struct {
+	ID      WCharID `json:"id"`
+	Value   rune    `json:"value"`
+	PrevID  WCharID `json:"prevId"`
+	NextID  WCharID `json:"nextId"`
+	Visible bool    `json:"visible"`
+}
+
+// CRDTDoc is the WOOT sequence backing a Document's content. Chars is kept
+// in the sequence's total order, bracketed by the begin/end sentinels, and
+// includes tombstones for deleted characters.
+type CRDTDoc struct {
+	mu    sync.Mutex
+	Chars []*WChar
+}
+
+// NewCRDTDoc returns an empty sequence bracketed by the begin/end sentinels.
+func NewCRDTDoc() *CRDTDoc {
+	return &CRDTDoc{
+		Chars: []*WChar{
+			{ID: beginID, Visible: false},
+			{ID: endID, Visible: false},
+		},
+	}
+}
+
+func (d *CRDTDoc) indexOf(id WCharID) int {
+	for i, c := range d.Chars {
+		if c.ID.equal(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Integrate inserts ch into the sequence according to its PrevID/NextID
+// constraint, already-present IDs are ignored so replayed or duplicate ops
+// are idempotent. Ties between characters inserted concurrently at the same
+// position are broken by comparing IDs lexicographically. Integrate always
+// inserts ch as visible — callers only ever give it fresh "insert" ops,
+// never tombstones, so a caller-supplied Visible (false whenever a client's
+// insert omits "visible") is never trusted; Delete is the only way a char
+// becomes invisible.
+func (d *CRDTDoc) Integrate(ch WChar) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.indexOf(ch.ID) != -1 {
+		return
+	}
+	ch.Visible = true
+
+	prevIdx := d.indexOf(ch.PrevID)
+	if prevIdx == -1 {
+		prevIdx = 0
+	}
+	nextIdx := d.indexOf(ch.NextID)
+	if nextIdx == -1 || nextIdx <= prevIdx {
+		nextIdx = len(d.Chars) - 1
+	}
+	// PrevID and NextID are resolved independently, so a caller can still
+	// hand us a pair that leaves no valid window (e.g. PrevID resolving to
+	// the end sentinel itself) even after the default above. Clamp prevIdx
+	// down until it's strictly before nextIdx instead of trusting the pair
+	// to be consistent, so the slice below can never invert.
+	if prevIdx >= nextIdx {
+		prevIdx = nextIdx - 1
+	}
+
+	between := d.Chars[prevIdx+1 : nextIdx]
+	pos := sort.Search(len(between), func(i int) bool {
+		return compareWCharID(between[i].ID, ch.ID) > 0
+	})
+
+	insertAt := prevIdx + 1 + pos
+	d.Chars = append(d.Chars, nil)
+	copy(d.Chars[insertAt+1:], d.Chars[insertAt:])
+	d.Chars[insertAt] = &ch
+}
+
+// Delete marks the character with id as a tombstone. It is a no-op if the
+// character is unknown or already deleted.
+func (d *CRDTDoc) Delete(id WCharID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	idx := d.indexOf(id)
+	if idx == -1 || !d.Chars[idx].Visible {
+		return false
+	}
+	d.Chars[idx].Visible = false
+	return true
+}
+
+// Snapshot returns a copy of the full ordered sequence, including
+// tombstones, for sending to joining clients so they converge.
+func (d *CRDTDoc) Snapshot() []WChar {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]WChar, len(d.Chars))
+	for i, c := range d.Chars {
+		out[i] = *c
+	}
+	return out
+}
+
+// Restore replaces the sequence wholesale with chars, preserving each one's
+// Visible exactly as given. Used to rehydrate a previously-taken Snapshot,
+// where chars already encodes tombstones alongside live characters — unlike
+// Integrate, which only ever handles fresh "insert" ops and so always forces
+// Visible=true.
+func (d *CRDTDoc) Restore(chars []WChar) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Chars = make([]*WChar, len(chars))
+	for i := range chars {
+		ch := chars[i]
+		d.Chars[i] = &ch
+	}
+}
+
+// String reconstructs the visible document content in sequence order.
+func (d *CRDTDoc) String() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	runes := make([]rune, 0, len(d.Chars))
+	for _, c := range d.Chars {
+		if c.Visible {
+			runes = append(runes, c.Value)
+		}
+	}
+	return string(runes)
+}
@@ -0,0 +1,105 @@
+package main
+
+import "testing"
+
+func TestIntegrateRendersInsertedChar(t *testing.T) {
+	d := NewCRDTDoc()
+	d.Integrate(WChar{ID: WCharID{SiteID: "u1", Clock: 1}, Value: 'a', PrevID: beginID, NextID: endID})
+
+	if got, want := d.String(), "a"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestIntegrateIgnoresCallerSuppliedVisible(t *testing.T) {
+	d := NewCRDTDoc()
+	// A client's insert may omit "visible", so a WChar with Visible false
+	// (as json.Unmarshal produces for such an insert) must still render.
+	d.Integrate(WChar{ID: WCharID{SiteID: "u1", Clock: 1}, Value: 'a', PrevID: beginID, NextID: endID, Visible: false})
+
+	if got, want := d.String(), "a"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestIntegrateIsIdempotent(t *testing.T) {
+	d := NewCRDTDoc()
+	ch := WChar{ID: WCharID{SiteID: "u1", Clock: 1}, Value: 'a', PrevID: beginID, NextID: endID}
+	d.Integrate(ch)
+	d.Integrate(ch)
+
+	if got, want := d.String(), "a"; got != want {
+		t.Fatalf("String() = %q, want %q (duplicate insert should be a no-op)", got, want)
+	}
+}
+
+// TestIntegratePrevAtEndSentinel guards against a panic: a char whose
+// PrevID resolves to the end sentinel with a zero-valued (omitted) NextID
+// used to derive an inverted slice window and panic with "slice bounds out
+// of range".
+func TestIntegratePrevAtEndSentinel(t *testing.T) {
+	d := NewCRDTDoc()
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Integrate panicked: %v", r)
+		}
+	}()
+	d.Integrate(WChar{ID: WCharID{SiteID: "u1", Clock: 1}, Value: 'a', PrevID: endID})
+
+	if got, want := d.String(), "a"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestDeleteMarksTombstone(t *testing.T) {
+	d := NewCRDTDoc()
+	id := WCharID{SiteID: "u1", Clock: 1}
+	d.Integrate(WChar{ID: id, Value: 'a', PrevID: beginID, NextID: endID})
+
+	if !d.Delete(id) {
+		t.Fatalf("Delete() = false, want true")
+	}
+	if got, want := d.String(), ""; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	if d.Delete(id) {
+		t.Fatalf("Delete() = true on an already-deleted char, want false")
+	}
+}
+
+func TestDeleteUnknownCharIsNoop(t *testing.T) {
+	d := NewCRDTDoc()
+	if d.Delete(WCharID{SiteID: "ghost", Clock: 99}) {
+		t.Fatalf("Delete() = true for an unknown id, want false")
+	}
+}
+
+func TestRestorePreservesTombstones(t *testing.T) {
+	d := NewCRDTDoc()
+	id := WCharID{SiteID: "u1", Clock: 1}
+	d.Integrate(WChar{ID: id, Value: 'a', PrevID: beginID, NextID: endID})
+	d.Delete(id)
+
+	snap := d.Snapshot()
+
+	restored := NewCRDTDoc()
+	restored.Restore(snap)
+	if got, want := restored.String(), ""; got != want {
+		t.Fatalf("String() after Restore = %q, want %q (tombstone should stay invisible)", got, want)
+	}
+}
+
+func TestCompareWCharIDBreaksTiesConsistently(t *testing.T) {
+	a := WCharID{SiteID: "u1", Clock: 1}
+	b := WCharID{SiteID: "u2", Clock: 1}
+	if compareWCharID(a, b) >= 0 {
+		t.Fatalf("compareWCharID(%v, %v) >= 0, want < 0", a, b)
+	}
+	if compareWCharID(b, a) <= 0 {
+		t.Fatalf("compareWCharID(%v, %v) <= 0, want > 0", b, a)
+	}
+	if compareWCharID(a, a) != 0 {
+		t.Fatalf("compareWCharID(%v, %v) != 0, want 0", a, a)
+	}
+}
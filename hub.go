@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// trieNode is one token of a subject trie. A concrete token (e.g. "doc")
+// gets its own child; "*" matches exactly one token; ">" matches the rest
+// of the subject and holds its subscribers directly rather than recursing
+// further, since it always terminates a match.
+type trieNode struct {
+	children map[string]*trieNode
+	subs     map[string]*User // userID -> User, subscribed exactly at this node
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{
+		children: make(map[string]*trieNode),
+		subs:     make(map[string]*User),
+	}
+}
+
+// Hub is a subject-based pub/sub bus: subjects are dot-separated tokens
+// (e.g. "doc.<id>.text"), subscriptions may use "*" for a single token or
+// ">" for the remaining tail, matched by walking a trie of subscribers.
+type Hub struct {
+	mu   sync.Mutex
+	root *trieNode
+}
+
+func NewHub() *Hub {
+	return &Hub{root: newTrieNode()}
+}
+
+func (h *Hub) nodeFor(subject string, create bool) *trieNode {
+	node := h.root
+	for _, tok := range strings.Split(subject, ".") {
+		child, ok := node.children[tok]
+		if !ok {
+			if !create {
+				return nil
+			}
+			child = newTrieNode()
+			node.children[tok] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// Subscribe registers u to receive every Publish whose subject matches the
+// given pattern, which may contain "*"/">" wildcards.
+func (h *Hub) Subscribe(u *User, subject string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodeFor(subject, true).subs[u.UserID] = u
+}
+
+// Unsubscribe removes u from the given subscription pattern.
+func (h *Hub) Unsubscribe(u *User, subject string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if node := h.nodeFor(subject, false); node != nil {
+		delete(node.subs, u.UserID)
+	}
+}
+
+// Match returns the deduplicated set of users subscribed to a pattern that
+// matches the given concrete (wildcard-free) subject.
+func (h *Hub) Match(subject string) []*User {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tokens := strings.Split(subject, ".")
+	seen := make(map[string]*User)
+
+	var walk func(node *trieNode, idx int)
+	walk = func(node *trieNode, idx int) {
+		if child, ok := node.children[">"]; ok {
+			for uid, u := range child.subs {
+				seen[uid] = u
+			}
+		}
+		if idx == len(tokens) {
+			for uid, u := range node.subs {
+				seen[uid] = u
+			}
+			return
+		}
+		if child, ok := node.children[tokens[idx]]; ok {
+			walk(child, idx+1)
+		}
+		if child, ok := node.children["*"]; ok {
+			walk(child, idx+1)
+		}
+	}
+	walk(h.root, 0)
+
+	out := make([]*User, 0, len(seen))
+	for _, u := range seen {
+		out = append(out, u)
+	}
+	return out
+}
@@ -1,16 +1,198 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 )
 
 func main() {
 	fmt.Println("Started Canvas")
 
+	switch os.Getenv("CANVAS_STORE") {
+	case "sqlite":
+		ss, err := NewSQLiteStore(envOr("CANVAS_SQLITE_PATH", "./data/canvas.db"))
+		if err != nil {
+			log.Fatalf("NewSQLiteStore: %v", err)
+		}
+		store = ss
+	default:
+		fs, err := NewFileStore("./data")
+		if err != nil {
+			log.Fatalf("NewFileStore: %v", err)
+		}
+		store = fs
+	}
+
+	bs, err := NewBlobStore("./data/blobs")
+	if err != nil {
+		log.Fatalf("NewBlobStore: %v", err)
+	}
+	blobStore = bs
+
+	secret := os.Getenv("CANVAS_JWT_SECRET")
+	if secret == "" {
+		log.Println("CANVAS_JWT_SECRET not set, using an insecure dev default")
+		secret = "dev-secret"
+	}
+	authenticator = NewJWTAuthenticator(secret)
+
 	http.Handle("/", http.FileServer(http.Dir("static")))
 	http.HandleFunc("/ws", handleWS)
+	http.HandleFunc("/docs", handleListDocs)
+	http.HandleFunc("/docs/", handleDocHistory)
+	http.HandleFunc("/upload", handleUpload)
+	http.HandleFunc("/blob/", handleBlob)
 
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// envOr returns the environment variable key, or fallback if it's unset.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// handleListDocs serves GET /docs, a directory of known documents for a
+// picker UI.
+func handleListDocs(w http.ResponseWriter, r *http.Request) {
+	if _, err := authenticator.Authenticate(tokenFromRequest(r)); err != nil {
+		http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	docs, err := store.ListDocs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(docs)
+}
+
+// handleDocHistory serves GET /docs/{id}/history?since=<unix-ms>, streaming
+// the ops a client needs to catch up on for undo/replay.
+func handleDocHistory(w http.ResponseWriter, r *http.Request) {
+	if _, err := authenticator.Authenticate(tokenFromRequest(r)); err != nil {
+		http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/docs/")
+	docID, rest, ok := strings.Cut(path, "/")
+	if !ok || rest != "history" {
+		http.NotFound(w, r)
+		return
+	}
+	if !validDocID(docID) {
+		http.Error(w, "invalid doc id", http.StatusBadRequest)
+		return
+	}
+
+	var since int64
+	if s := r.URL.Query().Get("since"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		since = v
+	}
+
+	_, ops, err := store.LoadDoc(docID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]Op, 0, len(ops))
+	for _, op := range ops {
+		if op.Timestamp > since {
+			out = append(out, op)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleUpload serves POST /upload, a multipart form upload (field "file")
+// that stores the bytes in blobStore and returns the blobId for a client to
+// reference from an "attach" WebSocket message.
+func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if _, err := authenticator.Authenticate(tokenFromRequest(r)); err != nil {
+		http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBlobSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "file too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	mime := header.Header.Get("Content-Type")
+	if mime == "" {
+		mime = http.DetectContentType(data)
+	}
+
+	blobID, err := blobStore.Put(data, mime, header.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"blobId": blobID,
+		"mime":   mime,
+		"size":   len(data),
+	})
+}
+
+// handleBlob serves GET /blob/{sha}, streaming back a previously uploaded
+// attachment's bytes. The Content-Type is sniffed from the bytes themselves
+// rather than taken from the stored metadata, since that metadata is just
+// the uploader's self-reported Content-Type header and can't be trusted to
+// pick a response header (an uploader claiming "text/html" would otherwise
+// get it served back as HTML from the app's origin).
+func handleBlob(w http.ResponseWriter, r *http.Request) {
+	if _, err := authenticator.Authenticate(tokenFromRequest(r)); err != nil {
+		http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sha := strings.TrimPrefix(r.URL.Path, "/blob/")
+	if !validBlobID(sha) {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, _, err := blobStore.Get(sha)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Write(data)
+}
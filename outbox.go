@@ -0,0 +1,75 @@
+package main
+
+import "sync"
+
+// outboxCapacity bounds how many recently-sent frames an Outbox keeps
+// around for a reconnecting client to replay.
+const outboxCapacity = 256
+
+type outboxEntry struct {
+	Seq  int64
+	Data []byte
+}
+
+// Outbox buffers the last N frames sent to a session behind monotonic
+// sequence numbers, so a client that reconnects with the same sessionID
+// can ask for everything after the last one it saw instead of the server
+// forcing a full "init".
+type Outbox struct {
+	mu  sync.Mutex
+	seq int64
+	buf []outboxEntry
+}
+
+// NewOutbox returns an empty outbox.
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+// Append records raw as the next frame in the sequence and returns its seq.
+func (o *Outbox) Append(raw []byte) int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	o.buf = append(o.buf, outboxEntry{Seq: o.seq, Data: raw})
+	if len(o.buf) > outboxCapacity {
+		o.buf = o.buf[len(o.buf)-outboxCapacity:]
+	}
+	return o.seq
+}
+
+// Since returns every buffered frame after lastSeq, oldest first. If
+// lastSeq is older than what's retained, the caller only gets what's left
+// in the buffer rather than an error; the gap means a full "init" is still
+// the client's fallback.
+func (o *Outbox) Since(lastSeq int64) [][]byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var out [][]byte
+	for _, e := range o.buf {
+		if e.Seq > lastSeq {
+			out = append(out, e.Data)
+		}
+	}
+	return out
+}
+
+var (
+	sessionMu sync.Mutex
+	sessions  = make(map[string]*Outbox)
+)
+
+// sessionOutbox returns the Outbox for sessionID, creating one if it
+// doesn't exist yet.
+func sessionOutbox(sessionID string) *Outbox {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if o, ok := sessions[sessionID]; ok {
+		return o
+	}
+	o := NewOutbox()
+	sessions[sessionID] = o
+	return o
+}
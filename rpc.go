@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	pendingMu sync.Mutex
+	pending   = make(map[string]chan Message)
+)
+
+// rpcCall publishes payload to subject as a request and blocks for a
+// single targeted reply carrying the same CorrelationID, instead of the
+// usual fire-and-forget broadcast. Used for request/response flows such as
+// a client asking a plugin subscribed to subject for a result.
+func rpcCall(u *User, subject string, payload Message, timeout time.Duration) (Message, error) {
+	correlationID := uuid.NewString()
+	payload.CorrelationID = correlationID
+	payload.ReplyTo = u.UserID
+	payload.UserID = u.UserID
+	payload.Timestamp = time.Now().UnixMilli()
+
+	replyCh := make(chan Message, 1)
+	pendingMu.Lock()
+	pending[correlationID] = replyCh
+	pendingMu.Unlock()
+	defer func() {
+		pendingMu.Lock()
+		delete(pending, correlationID)
+		pendingMu.Unlock()
+	}()
+
+	publishSubject(subject, payload, u.UserID)
+
+	select {
+	case reply := <-replyCh:
+		return reply, nil
+	case <-time.After(timeout):
+		return Message{}, fmt.Errorf("rpc call on %s timed out after %s", subject, timeout)
+	}
+}
+
+// deliverRPCReply hands msg to whichever rpcCall is waiting on its
+// CorrelationID, if any, and reports whether it found one. readPump calls
+// this first so matching replies never fall through to the normal
+// subject-broadcast switch.
+func deliverRPCReply(msg Message) bool {
+	if msg.CorrelationID == "" {
+		return false
+	}
+	pendingMu.Lock()
+	ch, ok := pending[msg.CorrelationID]
+	pendingMu.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- msg:
+	default:
+	}
+	return true
+}
+
+// publishSubject marshals m and delivers it to every user subscribed to a
+// pattern matching subject, same as publishRawToDoc but for subjects
+// outside the doc.<id>.<kind> shape (e.g. plugin request subjects).
+func publishSubject(subject string, m Message, senderID string) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	deliver(hub.Match(subject), buf, senderID)
+}
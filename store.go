@@ -0,0 +1,57 @@
+package main
+
+import "regexp"
+
+// docIDPattern restricts docIDs to a safe charset before they ever reach a
+// Store implementation, most of which (FileStore) build a filesystem path
+// directly from the docID — without this, a docID like "../../etc/passwd"
+// from the client-controlled ?doc= query param or /docs/{id} path segment
+// would escape the store directory.
+var docIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+// validDocID reports whether id is safe to use as (part of) a filesystem
+// path or SQL key.
+func validDocID(id string) bool {
+	return docIDPattern.MatchString(id)
+}
+
+// Op is a single persisted, ordered event against a document's op log. It
+// covers every mutation readPump applies to a Document so a Store can
+// replay a doc's full history without knowing about WebSocket framing.
+type Op struct {
+	Seq        int64       `json:"seq"`
+	Type       string      `json:"type"` // "insert", "delete", "rename", "attach"
+	Char       *WChar      `json:"char,omitempty"`
+	CharID     *WCharID    `json:"charId,omitempty"`
+	Title      string      `json:"title,omitempty"`
+	Attachment *Attachment `json:"attachment,omitempty"`
+	Timestamp  int64       `json:"timestamp"`
+}
+
+// Attachment is a file or image uploaded via POST /upload and referenced
+// from a document's content by blobId.
+type Attachment struct {
+	BlobID   string `json:"blobId"`
+	MimeType string `json:"mime"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Position int    `json:"position,omitempty"`
+}
+
+// DocMeta is the summary of a document returned by ListDocs, enough to
+// populate a document picker without loading the full op log.
+type DocMeta struct {
+	DocID string `json:"docId"`
+	Title string `json:"title"`
+}
+
+// Store persists documents and their op logs so a restart (or a second
+// server instance) can rehydrate instead of starting from a blank doc.
+// AppendOp is called for every mutating message readPump handles;
+// SaveSnapshot lets a Store compact the log it has accumulated so far.
+type Store interface {
+	LoadDoc(docID string) (*Document, []Op, error)
+	AppendOp(docID string, op Op) error
+	SaveSnapshot(docID string, doc *Document) error
+	ListDocs() ([]DocMeta, error)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore persists each document as an append-only JSON-lines log plus
+// an optional compacted snapshot, both under Dir/<docID>.{log,snapshot.json}.
+type FileStore struct {
+	Dir string
+
+	mu sync.Mutex // serializes writes across all docs; fine at this scale
+}
+
+// NewFileStore returns a FileStore rooted at dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+type fsSnapshot struct {
+	Title       string       `json:"title"`
+	Chars       []WChar      `json:"chars"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+func (s *FileStore) logPath(docID string) string { return filepath.Join(s.Dir, docID+".log") }
+func (s *FileStore) snapshotPath(docID string) string {
+	return filepath.Join(s.Dir, docID+".snapshot.json")
+}
+
+func (s *FileStore) LoadDoc(docID string) (*Document, []Op, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc := &Document{DocID: docID, Title: "Untitled Document", CRDT: NewCRDTDoc()}
+
+	if raw, err := os.ReadFile(s.snapshotPath(docID)); err == nil {
+		var snap fsSnapshot
+		if err := json.Unmarshal(raw, &snap); err != nil {
+			return nil, nil, err
+		}
+		doc.Title = snap.Title
+		doc.CRDT.Restore(snap.Chars)
+		doc.Attachments = snap.Attachments
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(s.logPath(docID))
+	if errors.Is(err, os.ErrNotExist) {
+		return doc, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var ops []Op
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var op Op
+		if err := json.Unmarshal([]byte(line), &op); err != nil {
+			return nil, nil, err
+		}
+		applyOp(doc, op)
+		ops = append(ops, op)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return doc, ops, nil
+}
+
+// applyOp replays a logged op onto doc, mirroring what readPump does live
+// for "insert"/"delete"/"rename"/"attach".
+func applyOp(doc *Document, op Op) {
+	switch op.Type {
+	case "insert":
+		if op.Char != nil {
+			doc.CRDT.Integrate(*op.Char)
+		}
+	case "delete":
+		if op.CharID != nil {
+			doc.CRDT.Delete(*op.CharID)
+		}
+	case "rename":
+		doc.Title = op.Title
+	case "attach":
+		if op.Attachment != nil {
+			doc.Attachments = append(doc.Attachments, *op.Attachment)
+		}
+	}
+}
+
+func (s *FileStore) AppendOp(docID string, op Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.logPath(docID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(buf, '\n'))
+	return err
+}
+
+func (s *FileStore) SaveSnapshot(docID string, doc *Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Title and Attachments are mutated under the global mu by readPump's
+	// "rename"/"attach" cases (CRDT.Snapshot locks itself), so reading them
+	// here needs the same lock.
+	mu.Lock()
+	snap := fsSnapshot{Title: doc.Title, Attachments: doc.Attachments}
+	mu.Unlock()
+	snap.Chars = doc.CRDT.Snapshot()
+	buf, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.snapshotPath(docID), buf, 0o644); err != nil {
+		return err
+	}
+	// Compact: the snapshot now covers everything appended so far, so the
+	// tail log can start clean.
+	if err := os.Remove(s.logPath(docID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) ListDocs() ([]DocMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var docs []DocMeta
+	for _, e := range entries {
+		name := e.Name()
+		var docID string
+		switch {
+		case strings.HasSuffix(name, ".snapshot.json"):
+			docID = strings.TrimSuffix(name, ".snapshot.json")
+		case strings.HasSuffix(name, ".log"):
+			docID = strings.TrimSuffix(name, ".log")
+		default:
+			continue
+		}
+		if seen[docID] {
+			continue
+		}
+		seen[docID] = true
+
+		title := "Untitled Document"
+		if raw, err := os.ReadFile(s.snapshotPath(docID)); err == nil {
+			var snap fsSnapshot
+			if json.Unmarshal(raw, &snap) == nil && snap.Title != "" {
+				title = snap.Title
+			}
+		}
+		docs = append(docs, DocMeta{DocID: docID, Title: title})
+	}
+	return docs, nil
+}
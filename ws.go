@@ -14,11 +14,102 @@ import (
 
 // User represents connected user
 type User struct {
-	UserID   string
-	UserName string
-	DocID    string
-	Conn     *websocket.Conn
-	Send     chan []byte
+	// UserID is fresh per connection (not the authenticated principal) so
+	// two simultaneous connections from the same PrincipalID never collide
+	// in clients/docUsers.
+	UserID string
+	// PrincipalID is claims.UserID, the JWT "sub" — who authenticated,
+	// as opposed to UserID, which identifies this connection.
+	PrincipalID string
+	UserName    string
+	DocID       string
+	SessionID   string // survives reconnects, unlike UserID; keys Outbox
+	Conn        *websocket.Conn
+	Send        chan []byte
+
+	// done is closed exactly once, by shutdown(), to tell writePump to
+	// stop. Send is never closed: closing it from outside writePump is
+	// what used to race writePump's range over it.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// closeFrame carries a close control frame for writePump to send
+	// before it shuts the connection down (see kick), so the close write
+	// never races writePump's own writes to the same *websocket.Conn.
+	closeFrame chan []byte
+
+	outbox *Outbox
+
+	// Permissions comes from the auth token's claims and gates which
+	// message types this user may send (see hasPermission).
+	Permissions []string
+
+	clockMu sync.Mutex
+	clock   int64 // Lamport clock for this site, used to stamp WChar IDs
+
+	// subjectsMu guards subjects: readPump mutates it on
+	// subscribe/unsubscribe, but sendRaw can also call unsubscribeAll on
+	// this same user from another goroutine (delivering a broadcast to it
+	// as a slow consumer), so both sides need the lock. explicitSubs is
+	// only ever touched by u's own readPump and is not guarded by it.
+	subjectsMu sync.Mutex
+	// subjects is the set of hub subjects this user is subscribed to, so
+	// readPump can unwind them on disconnect.
+	subjects map[string]bool
+	// explicitSubs is false while u relies on the default doc.<id>.>
+	// subscription made on join; it flips to true the first time the
+	// client sends its own "subscribe", narrowing what it receives.
+	explicitSubs bool
+}
+
+// shutdown tells writePump to stop and close the connection. Safe to call
+// more than once or from more than one goroutine.
+func (u *User) shutdown() {
+	u.closeOnce.Do(func() { close(u.done) })
+}
+
+// kick asks writePump to send a close control frame with reason before
+// shutting the connection down, routed through writePump rather than
+// written directly so it can never race writePump's own writes to the
+// same *websocket.Conn.
+func (u *User) kick(reason string) {
+	select {
+	case u.closeFrame <- websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason):
+	default:
+	}
+}
+
+// tick advances the user's Lamport clock past any seen clock value and
+// returns the new value, used as the Clock half of a freshly minted
+// WCharID.
+func (u *User) tick(seen int64) int64 {
+	u.clockMu.Lock()
+	defer u.clockMu.Unlock()
+	if seen > u.clock {
+		u.clock = seen
+	}
+	u.clock++
+	return u.clock
+}
+
+// hasPermission reports whether u's token granted perm.
+func hasPermission(u *User, perm string) bool {
+	for _, p := range u.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedMsg is the error frame sent back when a message type requires a
+// permission the sender's token doesn't carry.
+func deniedMsg(perm string) Message {
+	return Message{
+		Type:      "error",
+		Message:   "missing permission: " + perm,
+		Timestamp: time.Now().UnixMilli(),
+	}
 }
 
 type Message struct {
@@ -32,6 +123,26 @@ type Message struct {
 	Users     []UserMeta `json:"users,omitempty"`
 	Timestamp int64      `json:"timestamp,omitempty"`
 	Message   string     `json:"message,omitempty"`
+
+	Char   *WChar   `json:"char,omitempty"`   // insert op
+	CharID *WCharID `json:"charId,omitempty"` // delete op
+	Chars  []WChar  `json:"chars,omitempty"`  // full op log sent on init
+
+	Subject string `json:"subject,omitempty"` // subscribe/unsubscribe pattern
+
+	ReplyTo       string `json:"replyTo,omitempty"`       // userId the reply should be addressed to
+	CorrelationID string `json:"correlationId,omitempty"` // matches a request to its reply
+
+	TargetUserID string `json:"targetUserId,omitempty"` // "kick" target
+
+	SessionID string `json:"sessionId,omitempty"` // "resume" request
+	LastSeq   int64  `json:"lastSeq,omitempty"`   // "resume" request
+
+	Attachments []Attachment `json:"attachments,omitempty"` // full attachment list sent on init
+
+	BlobID   string `json:"blobId,omitempty"` // "attach" request, references a blob uploaded via POST /upload
+	MimeType string `json:"mime,omitempty"`   // "attach" request
+	Name     string `json:"name,omitempty"`   // "attach" request
 }
 
 type UserMeta struct {
@@ -40,9 +151,10 @@ type UserMeta struct {
 }
 
 type Document struct {
-	DocID   string
-	Title   string
-	Content string
+	DocID       string
+	Title       string
+	CRDT        *CRDTDoc
+	Attachments []Attachment
 }
 
 var (
@@ -60,32 +172,178 @@ var (
 	documents = make(map[string]*Document)
 
 	mu sync.Mutex
+
+	// store persists documents and their op logs; set in main before the
+	// server starts accepting connections.
+	store Store
+
+	// blobStore holds the bytes behind attachments uploaded via POST
+	// /upload; set in main before the server starts accepting connections.
+	blobStore *BlobStore
+
+	// hub routes every message by subject ("doc.<id>.text", "doc.<id>.cursor",
+	// "doc.<id>.presence", "doc.<id>.meta", ...) instead of a single
+	// per-doc room, so a client can subscribe to just the subjects it cares
+	// about.
+	hub = NewHub()
 )
 
+// docSubject builds the concrete subject a given kind of doc event is
+// published on.
+func docSubject(docID, kind string) string {
+	return "doc." + docID + "." + kind
+}
+
+// defaultSubject is what every user is auto-subscribed to on join so
+// existing clients keep seeing everything for their doc without sending
+// any "subscribe" frame.
+func defaultSubject(docID string) string {
+	return "doc." + docID + ".>"
+}
+
+func subscribe(u *User, subject string) {
+	hub.Subscribe(u, subject)
+	u.subjectsMu.Lock()
+	u.subjects[subject] = true
+	u.subjectsMu.Unlock()
+}
+
+func unsubscribe(u *User, subject string) {
+	hub.Unsubscribe(u, subject)
+	u.subjectsMu.Lock()
+	delete(u.subjects, subject)
+	u.subjectsMu.Unlock()
+}
+
+// unsubscribeAll may run concurrently with u's own readPump calling
+// subscribe/unsubscribe (see sendRaw, which calls this on a slow-consumer
+// recipient from whichever goroutine is delivering the broadcast), so it
+// takes a snapshot of subjects under the lock before unsubscribing from
+// each, rather than ranging over the live map unlocked.
+func unsubscribeAll(u *User) {
+	u.subjectsMu.Lock()
+	subjects := make([]string, 0, len(u.subjects))
+	for subject := range u.subjects {
+		subjects = append(subjects, subject)
+	}
+	u.subjectsMu.Unlock()
+
+	for _, subject := range subjects {
+		hub.Unsubscribe(u, subject)
+		u.subjectsMu.Lock()
+		delete(u.subjects, subject)
+		u.subjectsMu.Unlock()
+	}
+}
+
+func publishToDoc(docID, kind string, m Message, senderID string) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	publishRawToDoc(docID, kind, buf, senderID)
+}
+
+func publishRawToDoc(docID, kind string, raw []byte, senderID string) {
+	deliver(hub.Match(docSubject(docID, kind)), raw, senderID)
+}
+
+// deliver fans raw out to users, skipping senderID, and drops any user
+// whose Send buffer is full instead of blocking the publisher.
+func deliver(users []*User, raw []byte, senderID string) {
+	for _, u := range users {
+		if senderID != "" && u.UserID == senderID {
+			continue
+		}
+		sendRaw(u, raw)
+	}
+}
+
+// sendRaw records raw in u's outbox (so a reconnect can replay it) and
+// hands it to writePump, dropping u as a slow consumer if its Send buffer
+// is full rather than blocking the publisher.
+func sendRaw(u *User, raw []byte) {
+	u.outbox.Append(raw)
+	select {
+	case u.Send <- raw:
+	default:
+		mu.Lock()
+		delete(clients, u.UserID)
+		if userMap, ok := docUsers[u.DocID]; ok {
+			delete(userMap, u.UserID)
+		}
+		mu.Unlock()
+		unsubscribeAll(u)
+		u.shutdown()
+	}
+}
+
 func handleWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := Upgrader.Upgrade(w, r, nil)
+	claims, err := authenticator.Authenticate(tokenFromRequest(r))
 	if err != nil {
-		w.WriteHeader(500)
-		log.Printf("Error in Upgrading to Websocket: %v", err)
+		http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
 		return
 	}
-	fmt.Println("Connection Upgraded to Websockets successfully")
 
 	q := r.URL.Query()
 	docID := q.Get("doc")
 	if docID == "" {
 		docID = uuid.NewString()
+	} else if !validDocID(docID) {
+		http.Error(w, "invalid doc id", http.StatusBadRequest)
+		return
 	}
 
-	initialName := q.Get("user")
+	conn, err := Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		w.WriteHeader(500)
+		log.Printf("Error in Upgrading to Websocket: %v", err)
+		return
+	}
+	fmt.Println("Connection Upgraded to Websockets successfully")
+
 	userID := uuid.NewString()
+	initialName := claims.Name
+	if n := q.Get("user"); n != "" {
+		initialName = n
+	}
+
+	sessionID := q.Get("session")
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
 
 	user := &User{
-		UserID:   userID,
-		UserName: initialName,
-		DocID:    docID,
-		Conn:     conn,
-		Send:     make(chan []byte, 1024),
+		UserID:      userID,
+		PrincipalID: claims.UserID,
+		UserName:    initialName,
+		DocID:       docID,
+		SessionID:   sessionID,
+		Conn:        conn,
+		Send:        make(chan []byte, 1024),
+		done:        make(chan struct{}),
+		closeFrame:  make(chan []byte, 1),
+		outbox:      sessionOutbox(sessionID),
+		subjects:    make(map[string]bool),
+		Permissions: claims.Permissions,
+	}
+	subscribe(user, defaultSubject(docID))
+
+	mu.Lock()
+	_, known := documents[docID]
+	mu.Unlock()
+
+	if !known {
+		loaded, _, err := store.LoadDoc(docID)
+		if err != nil {
+			log.Printf("LoadDoc(%s): %v", docID, err)
+			loaded = &Document{DocID: docID, Title: "Untitled Document", CRDT: NewCRDTDoc()}
+		}
+		mu.Lock()
+		if _, ok := documents[docID]; !ok {
+			documents[docID] = loaded
+		}
+		mu.Unlock()
 	}
 
 	mu.Lock()
@@ -94,14 +352,6 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 		docUsers[docID] = make(map[string]*User)
 	}
 	docUsers[docID][userID] = user
-
-	if _, ok := documents[docID]; !ok {
-		documents[docID] = &Document{
-			DocID:   docID,
-			Title:   "Untitled Document",
-			Content: "",
-		}
-	}
 	doc := documents[docID]
 
 	usersList := make([]UserMeta, 0, len(docUsers[docID]))
@@ -110,17 +360,22 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 	}
 	mu.Unlock()
 
-	// Send initial content
+	// Send the full op log so the joining client converges to the same
+	// sequence, plus the flattened content for convenience.
 	initMsg := Message{
-		Type:      "init",
-		Content:   doc.Content,
-		Title:     doc.Title,
-		UserID:    userID,
-		Timestamp: time.Now().UnixMilli(),
-		Users:     usersList,
+		Type:        "init",
+		Content:     doc.CRDT.String(),
+		Chars:       doc.CRDT.Snapshot(),
+		Title:       doc.Title,
+		UserID:      userID,
+		Timestamp:   time.Now().UnixMilli(),
+		Users:       usersList,
+		Attachments: doc.Attachments,
 	}
+	go writePump(user)
+
 	data, _ := json.Marshal(initMsg)
-	conn.WriteMessage(websocket.TextMessage, data)
+	sendRaw(user, data)
 
 	joined := Message{
 		Type:      "user_joined",
@@ -128,21 +383,54 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 		UserName:  user.UserName,
 		Timestamp: time.Now().UnixMilli(),
 	}
-	broadcastToDoc(docID, joined, userID)
+	publishToDoc(docID, "presence", joined, userID)
 	sendUsersListToDoc(docID)
 
-	go writePump(user)
 	readPump(user)
 }
 
-// writePump takes message from broadcast and
-// writes to client's connection i.e. it sends message to the client
-// this connects to onmessage()->handleMessage() in our js script
+const (
+	pingInterval = 30 * time.Second
+	pongWait     = 60 * time.Second
+	writeWait    = 10 * time.Second
+
+	// spellcheckTimeout bounds how long a "spellcheck" request waits for a
+	// plugin subscribed to doc.<id>.spellcheck.request to reply via rpcCall.
+	spellcheckTimeout = 5 * time.Second
+)
+
+// writePump owns u.Conn's write side and its lifecycle: it's the only
+// goroutine that writes to the connection or closes it, so a slow consumer
+// elsewhere can never race a close against an in-flight write. It also
+// pings the client every pingInterval to keep the read deadline in
+// readPump's pong handler from expiring on an otherwise-idle connection.
 func writePump(u *User) {
-	for msg := range u.Send {
-		if err := u.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-			log.Printf("Write error: %v", err)
-			break
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		u.Conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-u.Send:
+			u.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := u.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Printf("write error: %v", err)
+				return
+			}
+		case <-ticker.C:
+			u.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := u.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("ping error: %v", err)
+				return
+			}
+		case frame := <-u.closeFrame:
+			u.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			u.Conn.WriteMessage(websocket.CloseMessage, frame)
+			return
+		case <-u.done:
+			return
 		}
 	}
 }
@@ -151,6 +439,12 @@ func writePump(u *User) {
 // i.e. it receives message from client
 // this connects to our sendMesage() in js script
 func readPump(u *User) {
+	u.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	u.Conn.SetPongHandler(func(string) error {
+		u.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
 	defer func() {
 		mu.Lock()
 		delete(clients, u.UserID)
@@ -161,6 +455,7 @@ func readPump(u *User) {
 			}
 		}
 		mu.Unlock()
+		unsubscribeAll(u)
 
 		left := Message{
 			Type:      "user_left",
@@ -168,17 +463,28 @@ func readPump(u *User) {
 			UserName:  u.UserName,
 			Timestamp: time.Now().UnixMilli(),
 		}
-		broadcastToDoc(u.DocID, left, u.UserID)
+		publishToDoc(u.DocID, "presence", left, u.UserID)
 		sendUsersListToDoc(u.DocID)
 
-		u.Conn.Close()
-		close(u.Send)
+		u.shutdown()
 	}()
 
 	for {
 		_, raw, err := u.Conn.ReadMessage()
 		if err != nil {
-			log.Printf("read error: %v", err)
+			if websocket.IsUnexpectedCloseError(err,
+				websocket.CloseNormalClosure,
+				websocket.CloseGoingAway,
+				websocket.CloseNoStatusReceived,
+			) {
+				log.Printf("unexpected close error: %v", err)
+			} else if !websocket.IsCloseError(err,
+				websocket.CloseNormalClosure,
+				websocket.CloseGoingAway,
+				websocket.CloseNoStatusReceived,
+			) {
+				log.Printf("read error: %v", err)
+			}
 			break
 		}
 
@@ -192,9 +498,38 @@ func readPump(u *User) {
 			u.UserName = msg.UserName
 		}
 		msg.UserName = u.UserName
-		msg.Timestamp = time.Now().Unix()
+		msg.Timestamp = time.Now().UnixMilli()
+
+		if deliverRPCReply(msg) {
+			continue
+		}
 
 		switch msg.Type {
+		case "subscribe":
+			if msg.Subject == "" {
+				continue
+			}
+			if !u.explicitSubs {
+				unsubscribe(u, defaultSubject(u.DocID))
+				u.explicitSubs = true
+			}
+			subscribe(u, msg.Subject)
+		case "unsubscribe":
+			if msg.Subject == "" {
+				continue
+			}
+			unsubscribe(u, msg.Subject)
+		case "resume":
+			// Only ever replay u's own outbox: sessionOutbox is keyed by a
+			// client-supplied sessionId, and nothing else ties it to the
+			// authenticated connection, so resuming anyone else's session
+			// would hand back whatever targeted replies it had buffered.
+			if msg.SessionID == "" || msg.SessionID != u.SessionID {
+				continue
+			}
+			for _, frame := range sessionOutbox(msg.SessionID).Since(msg.LastSeq) {
+				sendRaw(u, frame)
+			}
 		case "username_change":
 			u.UserName = msg.UserName
 			sendUsersListToDoc(u.DocID)
@@ -204,25 +539,109 @@ func readPump(u *User) {
 				UserName:  u.UserName,
 				Timestamp: time.Now().UnixMilli(),
 			}
-			broadcastToDoc(u.DocID, joined, u.UserID)
-		case "text_change":
-			if content := msg.Content; content != "" || content == "" {
-				mu.Lock()
-				if d, ok := documents[u.DocID]; ok {
-					d.Content = msg.Content
+			publishToDoc(u.DocID, "presence", joined, u.UserID)
+		case "insert":
+			if !hasPermission(u, "edit") {
+				sendToUser(u, deniedMsg("edit"))
+				continue
+			}
+			if msg.Char == nil {
+				continue
+			}
+			ch := *msg.Char
+			ch.ID.SiteID = u.UserID
+			ch.ID.Clock = u.tick(ch.ID.Clock)
+			msg.Char = &ch
+
+			mu.Lock()
+			d, ok := documents[u.DocID]
+			mu.Unlock()
+			if !ok {
+				continue
+			}
+			d.CRDT.Integrate(ch)
+			if err := store.AppendOp(u.DocID, Op{Type: "insert", Char: &ch, Timestamp: msg.Timestamp}); err != nil {
+				log.Printf("AppendOp(%s, insert): %v", u.DocID, err)
+			}
+
+			out, err := json.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			publishRawToDoc(u.DocID, "text", out, u.UserID)
+		case "delete":
+			if !hasPermission(u, "edit") {
+				sendToUser(u, deniedMsg("edit"))
+				continue
+			}
+			if msg.CharID == nil {
+				continue
+			}
+			mu.Lock()
+			d, ok := documents[u.DocID]
+			mu.Unlock()
+			if !ok {
+				continue
+			}
+			if d.CRDT.Delete(*msg.CharID) {
+				if err := store.AppendOp(u.DocID, Op{Type: "delete", CharID: msg.CharID, Timestamp: msg.Timestamp}); err != nil {
+					log.Printf("AppendOp(%s, delete): %v", u.DocID, err)
 				}
-				mu.Unlock()
 			}
-			broadcastRawToDoc(u.DocID, raw, u.UserID)
+			publishRawToDoc(u.DocID, "text", raw, u.UserID)
 		case "cursor_position":
-			broadcastRawToDoc(u.DocID, raw, u.UserID)
+			publishRawToDoc(u.DocID, "cursor", raw, u.UserID)
+		case "get_document":
+			// Targeted reply instead of a broadcast: the client matches it
+			// back up by CorrelationID.
+			resp := Message{
+				Type:          "document",
+				CorrelationID: msg.CorrelationID,
+				Timestamp:     time.Now().UnixMilli(),
+			}
+			mu.Lock()
+			d, ok := documents[u.DocID]
+			mu.Unlock()
+			if ok {
+				resp.Content = d.CRDT.String()
+				resp.Title = d.Title
+				resp.Chars = d.CRDT.Snapshot()
+			}
+			sendToUser(u, resp)
+		case "spellcheck":
+			// Request/response over the hub rather than the usual
+			// fire-and-forget broadcast: a plugin subscribed to
+			// doc.<id>.spellcheck.request replies with the same
+			// CorrelationID, and rpcCall blocks for exactly that reply.
+			if msg.Content == "" {
+				continue
+			}
+			reply, err := rpcCall(u, docSubject(u.DocID, "spellcheck.request"), Message{
+				Type:    "spellcheck_request",
+				Content: msg.Content,
+			}, spellcheckTimeout)
+			if err != nil {
+				sendToUser(u, Message{
+					Type:      "error",
+					Message:   "spellcheck: " + err.Error(),
+					Timestamp: time.Now().UnixMilli(),
+				})
+				continue
+			}
+			reply.Type = "spellcheck_result"
+			sendToUser(u, reply)
 		case "save":
-			if msg.Content != "" {
-				mu.Lock()
-				if d, ok := documents[u.DocID]; ok {
-					d.Content = msg.Content
+			if !hasPermission(u, "edit") {
+				sendToUser(u, deniedMsg("edit"))
+				continue
+			}
+			mu.Lock()
+			d, ok := documents[u.DocID]
+			mu.Unlock()
+			if ok {
+				if err := store.SaveSnapshot(u.DocID, d); err != nil {
+					log.Printf("SaveSnapshot(%s): %v", u.DocID, err)
 				}
-				mu.Unlock()
 			}
 			resp := Message{
 				Type:      "save_success",
@@ -230,20 +649,79 @@ func readPump(u *User) {
 			}
 			sendToUser(u, resp)
 		case "rename":
+			if !hasPermission(u, "rename") {
+				sendToUser(u, deniedMsg("rename"))
+				continue
+			}
 			if msg.Title != "" {
 				mu.Lock()
 				if d, ok := documents[u.DocID]; ok {
 					d.Title = msg.Title
 				}
 				mu.Unlock()
+				if err := store.AppendOp(u.DocID, Op{Type: "rename", Title: msg.Title, Timestamp: msg.Timestamp}); err != nil {
+					log.Printf("AppendOp(%s, rename): %v", u.DocID, err)
+				}
 				// broadcast rename to other clients (and optionally to sender)
 				renameMsg := Message{
 					Type:      "rename",
 					Title:     msg.Title,
 					Timestamp: time.Now().UnixMilli(),
 				}
-				broadcastToDoc(u.DocID, renameMsg, "")
+				publishToDoc(u.DocID, "meta", renameMsg, "")
+			}
+		case "attach":
+			if !hasPermission(u, "edit") {
+				sendToUser(u, deniedMsg("edit"))
+				continue
+			}
+			if msg.BlobID == "" {
+				continue
+			}
+			meta, err := blobStore.Stat(msg.BlobID)
+			if err != nil {
+				sendToUser(u, Message{Type: "error", Message: "unknown blobId", Timestamp: time.Now().UnixMilli()})
+				continue
+			}
+			att := Attachment{
+				BlobID:   msg.BlobID,
+				MimeType: meta.Mime,
+				Name:     meta.Name,
+				Size:     meta.Size,
+				Position: msg.Position,
+			}
+
+			mu.Lock()
+			if d, ok := documents[u.DocID]; ok {
+				d.Attachments = append(d.Attachments, att)
+			}
+			mu.Unlock()
+			if err := store.AppendOp(u.DocID, Op{Type: "attach", Attachment: &att, Timestamp: msg.Timestamp}); err != nil {
+				log.Printf("AppendOp(%s, attach): %v", u.DocID, err)
+			}
+
+			attachMsg := Message{
+				Type:        "attachment",
+				UserID:      u.UserID,
+				Timestamp:   time.Now().UnixMilli(),
+				Attachments: []Attachment{att},
+			}
+			publishToDoc(u.DocID, "attachments", attachMsg, "")
+		case "kick":
+			if !hasPermission(u, "op") {
+				sendToUser(u, deniedMsg("op"))
+				continue
+			}
+			if msg.TargetUserID == "" {
+				continue
+			}
+			mu.Lock()
+			target, ok := clients[msg.TargetUserID]
+			mu.Unlock()
+			if !ok {
+				continue
 			}
+			target.kick("kicked")
 		default:
 			// unknown message: ignore or optionally respond with error
 			errMsg := Message{
@@ -261,40 +739,7 @@ func sendToUser(u *User, m Message) {
 	if err != nil {
 		return
 	}
-	select {
-	case u.Send <- buf:
-	default:
-		log.Printf("dropping message to %s", u.UserName)
-	}
-}
-
-func broadcastToDoc(docID string, m Message, senderID string) {
-	buf, err := json.Marshal(m)
-	if err != nil {
-		return
-	}
-	broadcastRawToDoc(docID, buf, senderID)
-}
-
-func broadcastRawToDoc(docId string, msg []byte, senderID string) {
-	mu.Lock()
-	defer mu.Unlock()
-	usersMap, ok := docUsers[docId]
-	if !ok {
-		return
-	}
-	for uid, u := range usersMap {
-		if senderID != "" && uid == senderID {
-			continue
-		}
-		select {
-		case u.Send <- msg:
-		default:
-			close(u.Send)
-			delete(clients, uid)
-			delete(usersMap, uid)
-		}
-	}
+	sendRaw(u, buf)
 }
 
 func sendUsersListToDoc(docID string) {
@@ -315,5 +760,5 @@ func sendUsersListToDoc(docID string) {
 		Users:     users,
 		Timestamp: time.Now().UnixMilli(),
 	}
-	broadcastToDoc(docID, msg, "")
+	publishToDoc(docID, "presence", msg, "")
 }